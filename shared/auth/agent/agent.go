@@ -0,0 +1,244 @@
+// Package agent provisions non-human "agent" identities — headless trading
+// bots running on remote hosts — on top of the same Kratos tenant used for
+// human users, so they can authenticate through the existing
+// auth.KratosClient.SessionMiddleware.
+package agent
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	client "github.com/ory/kratos-client-go"
+
+	"github.com/tradingbot/platform/shared/auth/hooks"
+)
+
+// agentSchemaID is the Kratos identity schema agents are created against,
+// distinct from the human user schema so agent traits stay minimal.
+const agentSchemaID = "agent"
+
+const usernameTokenBytes = 6
+const passwordTokenBytes = 32
+
+// Store persists the association between an agent identity and the user who
+// provisioned it, and grants the RBAC role that scopes an agent down to
+// bot-execution endpoints.
+type Store interface {
+	// CreateAgentLink records the person_agents row for agentID/ownerUserID
+	// and assigns scopes as the agent's RBAC role.
+	CreateAgentLink(ctx context.Context, agentID, ownerUserID, name string, scopes []string) error
+	ListAgentLinks(ctx context.Context, ownerUserID string) ([]Link, error)
+	DeleteAgentLink(ctx context.Context, agentID string) error
+}
+
+// Link is a person_agents row: one agent identity owned by one human user.
+type Link struct {
+	AgentID     string
+	OwnerUserID string
+	Name        string
+	Scopes      []string
+}
+
+// GenerateAgentRequest describes the agent identity to provision.
+type GenerateAgentRequest struct {
+	Name   string
+	Owner  string // owner user ID
+	Scopes []string
+}
+
+// GenerateAgentResponse carries the agent's plaintext credentials. They are
+// returned exactly once; Kratos only ever stores the password hash.
+type GenerateAgentResponse struct {
+	AgentID   string
+	Username  string
+	Password  string
+	Bootstrap BootstrapBundle
+}
+
+// BootstrapBundle is everything a freshly-provisioned agent needs to start
+// calling home: where to connect and which identity it is.
+type BootstrapBundle struct {
+	AgentID    string
+	ServerURLs []string
+}
+
+// Service provisions and manages agent identities.
+type Service struct {
+	admin      *client.APIClient
+	public     *client.APIClient
+	store      Store
+	serverURLs []string
+	hooks      *hooks.Dispatcher
+}
+
+// NewService builds an agent Service. admin is used to create/delete Kratos
+// identities and sessions; public drives the login flow in LoginHandler.
+func NewService(admin, public *client.APIClient, store Store, serverURLs []string) *Service {
+	return &Service{admin: admin, public: public, store: store, serverURLs: serverURLs}
+}
+
+// WithHooks attaches a webhook dispatcher so a successful /agent/login
+// fires a real hooks.EventLogin, carrying the flow ID that produced it.
+func (s *Service) WithHooks(d *hooks.Dispatcher) *Service {
+	s.hooks = d
+	return s
+}
+
+// GenerateAgent provisions a new headless agent identity: a random
+// username/password pair, a Kratos identity under the agent schema, a
+// person_agents link back to the owning user, and the bot-execution RBAC
+// role (via Store.CreateAgentLink).
+func (s *Service) GenerateAgent(ctx context.Context, req GenerateAgentRequest) (*GenerateAgentResponse, error) {
+	username, err := randomToken(usernameTokenBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate agent username: %w", err)
+	}
+	username = "agent-" + username
+
+	password, err := randomToken(passwordTokenBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate agent password: %w", err)
+	}
+
+	identity, resp, err := s.admin.IdentityAPI.CreateIdentity(ctx).
+		CreateIdentityBody(client.CreateIdentityBody{
+			SchemaId: agentSchemaID,
+			Traits: map[string]interface{}{
+				"name":          req.Name,
+				"owner_user_id": req.Owner,
+				"kind":          "agent",
+				"username":      username,
+			},
+			Credentials: &client.IdentityWithCredentials{
+				Password: &client.IdentityWithCredentialsPassword{
+					Config: &client.IdentityWithCredentialsPasswordConfig{
+						Password: &password,
+					},
+				},
+			},
+		}).
+		Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create agent identity: %w", err)
+	}
+	if resp.StatusCode != http.StatusCreated {
+		return nil, fmt.Errorf("failed to create agent identity: status %d", resp.StatusCode)
+	}
+
+	agentID := identity.GetId()
+
+	if err := s.store.CreateAgentLink(ctx, agentID, req.Owner, req.Name, req.Scopes); err != nil {
+		// Don't leave an unowned, unrevocable identity behind: the caller
+		// never sees agentID/password on this error path, so nothing else
+		// could ever clean it up.
+		if _, delErr := s.admin.IdentityAPI.DeleteIdentity(ctx, agentID).Execute(); delErr != nil {
+			return nil, fmt.Errorf("failed to link agent to owner: %w (and failed to roll back identity %s: %v)", err, agentID, delErr)
+		}
+		return nil, fmt.Errorf("failed to link agent to owner: %w", err)
+	}
+
+	return &GenerateAgentResponse{
+		AgentID:  agentID,
+		Username: username,
+		Password: password,
+		Bootstrap: BootstrapBundle{
+			AgentID:    agentID,
+			ServerURLs: s.serverURLs,
+		},
+	}, nil
+}
+
+// ListAgents returns the agents owned by ownerUserID.
+func (s *Service) ListAgents(ctx context.Context, ownerUserID string) ([]Link, error) {
+	return s.store.ListAgentLinks(ctx, ownerUserID)
+}
+
+// RevokeAgent deletes the agent's Kratos identity and revokes any sessions
+// it still holds, then removes the person_agents link.
+func (s *Service) RevokeAgent(ctx context.Context, agentID string) error {
+	if sessions, resp, err := s.admin.IdentityAPI.ListIdentitySessions(ctx, agentID).Execute(); err == nil && resp.StatusCode == http.StatusOK {
+		for _, session := range sessions {
+			_, _ = s.admin.IdentityAPI.DisableSession(ctx, session.GetId()).Execute()
+		}
+	}
+
+	resp, err := s.admin.IdentityAPI.DeleteIdentity(ctx, agentID).Execute()
+	if err != nil {
+		return fmt.Errorf("failed to delete agent identity: %w", err)
+	}
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("failed to delete agent identity: status %d", resp.StatusCode)
+	}
+
+	return s.store.DeleteAgentLink(ctx, agentID)
+}
+
+// LoginHandler trades an agent's username/password for a session token
+// usable by auth.KratosClient.SessionMiddleware, by driving Kratos's native
+// (non-browser) login flow with the password method. Session lifespan for
+// the agent schema should be configured long-lived on the Kratos side, since
+// bots can't complete an interactive re-login.
+func (s *Service) LoginHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var creds struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		flow, _, err := s.public.FrontendAPI.CreateNativeLoginFlow(r.Context()).Execute()
+		if err != nil {
+			http.Error(w, "failed to start login flow", http.StatusInternalServerError)
+			return
+		}
+
+		result, resp, err := s.public.FrontendAPI.UpdateLoginFlow(r.Context()).
+			Flow(flow.GetId()).
+			UpdateLoginFlowBody(client.UpdateLoginFlowBody{
+				UpdateLoginFlowWithPasswordMethod: &client.UpdateLoginFlowWithPasswordMethod{
+					Method:     "password",
+					Identifier: creds.Username,
+					Password:   creds.Password,
+				},
+			}).
+			Execute()
+		if err != nil || resp.StatusCode != http.StatusOK {
+			http.Error(w, "invalid agent credentials", http.StatusUnauthorized)
+			return
+		}
+
+		if s.hooks != nil {
+			flowID := flow.GetId()
+			identity, session := result.Session.Identity, result.Session
+			go func() {
+				_ = s.hooks.Fire(context.Background(), hooks.Payload{
+					Event:    hooks.EventLogin,
+					Identity: identity,
+					Session:  session,
+					Flow:     flowID,
+				})
+			}()
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"session_token": result.GetSessionToken(),
+			"agent_id":      result.Session.Identity.GetId(),
+		})
+	}
+}
+
+func randomToken(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to read random bytes: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
@@ -0,0 +1,276 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/clerk/clerk-sdk-go/v2"
+	clerkjwt "github.com/clerk/clerk-sdk-go/v2/jwt"
+	clerkuser "github.com/clerk/clerk-sdk-go/v2/user"
+	jwtlib "github.com/golang-jwt/jwt/v5"
+	gocache "github.com/patrickmn/go-cache"
+)
+
+const (
+	defaultClerkSessionTTL  = 24 * time.Hour
+	defaultClerkInternalTTL = 15 * time.Minute
+)
+
+// ClerkConfig configures ClerkClient, the AUTH_MODE=clerk Provider.
+type ClerkConfig struct {
+	SecretKey string
+
+	// JWTSecret signs the short-lived internal JWT that SessionMiddleware
+	// mints for every request it authenticates; it is the configured DB
+	// secret, not Clerk's.
+	JWTSecret string
+
+	// SessionTTL is how long a validated session/user pair is cached
+	// before Clerk is hit again. Defaults to 24h.
+	SessionTTL time.Duration
+
+	// InternalTTL is the lifetime of the minted internal JWT. Defaults to
+	// 15m.
+	InternalTTL time.Duration
+}
+
+// ClerkClient is the Clerk-backed Provider implementation, selected via
+// AUTH_MODE=clerk (see NewProvider).
+type ClerkClient struct {
+	cfg     ClerkConfig
+	users   *clerkuser.Client
+	cache   *gocache.Cache
+	persons PersonStore
+}
+
+var _ Provider = (*ClerkClient)(nil)
+
+// NewClerkClient builds a ClerkClient. persons may be nil if no local person
+// record should be upserted on first sight.
+func NewClerkClient(cfg ClerkConfig, persons PersonStore) *ClerkClient {
+	if cfg.SessionTTL == 0 {
+		cfg.SessionTTL = defaultClerkSessionTTL
+	}
+	if cfg.InternalTTL == 0 {
+		cfg.InternalTTL = defaultClerkInternalTTL
+	}
+
+	return &ClerkClient{
+		cfg:     cfg,
+		users:   clerkuser.NewClient(&clerk.ClientConfig{BackendConfig: clerk.BackendConfig{Key: &cfg.SecretKey}}),
+		cache:   gocache.New(cfg.SessionTTL, cfg.SessionTTL/2),
+		persons: persons,
+	}
+}
+
+// ValidateSession verifies the Clerk session JWT against Clerk's JWKS,
+// returning the cached user when available to avoid a Clerk round-trip on
+// every request.
+func (c *ClerkClient) ValidateSession(ctx context.Context, sessionToken string) (*KratosUser, error) {
+	if sessionToken == "" {
+		return nil, fmt.Errorf("session token is required")
+	}
+
+	cacheKey := hashToken(sessionToken)
+	if cached, ok := c.cache.Get(cacheKey); ok {
+		return cached.(*KratosUser), nil
+	}
+
+	claims, err := clerkjwt.Verify(ctx, &clerkjwt.VerifyParams{Token: sessionToken})
+	if err != nil {
+		return nil, fmt.Errorf("session validation failed: %w", err)
+	}
+
+	clerkUser, err := c.users.Get(ctx, claims.Subject)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load clerk user: %w", err)
+	}
+
+	user := clerkUserToKratosUser(clerkUser)
+
+	if c.persons != nil {
+		if err := c.persons.UpsertPerson(ctx, user); err != nil {
+			return nil, fmt.Errorf("failed to upsert person: %w", err)
+		}
+	}
+
+	c.cache.Set(cacheKey, user, c.cfg.SessionTTL)
+
+	return user, nil
+}
+
+func (c *ClerkClient) GetUser(ctx context.Context, userID string) (*KratosUser, error) {
+	clerkUser, err := c.users.Get(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return clerkUserToKratosUser(clerkUser), nil
+}
+
+func (c *ClerkClient) UpdateUser(ctx context.Context, userID string, traits map[string]interface{}) (*KratosUser, error) {
+	clerkUser, err := c.users.Update(ctx, userID, &clerkuser.UpdateParams{
+		FirstName:      stringTraitPtr(traits, "first_name"),
+		LastName:       stringTraitPtr(traits, "last_name"),
+		PublicMetadata: traitsToMetadata(traits),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update user: %w", err)
+	}
+
+	c.cache.Flush()
+
+	return clerkUserToKratosUser(clerkUser), nil
+}
+
+func (c *ClerkClient) DeleteUser(ctx context.Context, userID string) error {
+	if _, err := c.users.Delete(ctx, userID); err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+
+	// Cached entries are keyed by session token hash, not user ID, so we
+	// can't evict precisely; drop everything rather than serve a deleted
+	// user from cache.
+	c.cache.Flush()
+
+	return nil
+}
+
+func (c *ClerkClient) ListUserSessions(ctx context.Context, userID string) ([]Session, error) {
+	list, err := clerkuser.ListSessions(ctx, userID, &clerkuser.ListSessionsParams{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	sessions := make([]Session, 0, len(list.Sessions))
+	for _, s := range list.Sessions {
+		sessions = append(sessions, Session{
+			ID:         s.ID,
+			IdentityID: userID,
+			Active:     s.Status == "active",
+			ExpiresAt:  time.UnixMilli(s.ExpireAt),
+		})
+	}
+
+	return sessions, nil
+}
+
+func (c *ClerkClient) RevokeSession(ctx context.Context, sessionID string) error {
+	if _, err := clerkuser.RevokeSession(ctx, sessionID); err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+
+	// Cached entries are keyed by session token hash, not session ID, so we
+	// can't evict precisely; drop everything rather than keep serving the
+	// revoked session's user for up to c.cfg.SessionTTL.
+	c.cache.Flush()
+
+	return nil
+}
+
+func (c *ClerkClient) SessionMiddleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sessionToken := extractSessionToken(r)
+			if sessionToken == "" {
+				if cookie, err := r.Cookie("__session"); err == nil {
+					sessionToken = cookie.Value
+				}
+			}
+
+			if sessionToken == "" {
+				http.Error(w, "Session token required", http.StatusUnauthorized)
+				return
+			}
+
+			user, err := c.ValidateSession(r.Context(), sessionToken)
+			if err != nil {
+				http.Error(w, "Invalid session", http.StatusUnauthorized)
+				return
+			}
+
+			internalToken, err := c.mintInternalToken(user)
+			if err != nil {
+				http.Error(w, "Invalid session", http.StatusUnauthorized)
+				return
+			}
+
+			ctx := NewContext(r.Context(), user)
+			ctx = newInternalTokenContext(ctx, internalToken)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// mintInternalToken signs a short-lived internal JWT for user, scoped to
+// c.cfg.JWTSecret, so downstream services don't need to trust Clerk tokens
+// directly.
+func (c *ClerkClient) mintInternalToken(user *KratosUser) (string, error) {
+	now := time.Now()
+	claims := jwtlib.RegisteredClaims{
+		Subject:   user.ID,
+		IssuedAt:  jwtlib.NewNumericDate(now),
+		ExpiresAt: jwtlib.NewNumericDate(now.Add(c.cfg.InternalTTL)),
+	}
+
+	token := jwtlib.NewWithClaims(jwtlib.SigningMethodHS256, claims)
+	return token.SignedString([]byte(c.cfg.JWTSecret))
+}
+
+func clerkUserToKratosUser(u *clerk.User) *KratosUser {
+	user := &KratosUser{
+		ID:        u.ID,
+		Active:    !u.Banned,
+		CreatedAt: time.UnixMilli(u.CreatedAt),
+		UpdatedAt: time.UnixMilli(u.UpdatedAt),
+		Traits:    u.PublicMetadata,
+	}
+
+	if u.Username != nil {
+		user.Username = *u.Username
+	}
+	if u.FirstName != nil {
+		user.FirstName = *u.FirstName
+	}
+	if u.LastName != nil {
+		user.LastName = *u.LastName
+	}
+	if u.ImageURL != nil {
+		user.Avatar = *u.ImageURL
+	}
+
+	for _, addr := range u.EmailAddresses {
+		if addr.ID == u.PrimaryEmailAddressID {
+			user.Email = addr.EmailAddress
+			user.EmailVerified = addr.Verification != nil && addr.Verification.Status == "verified"
+			break
+		}
+	}
+
+	return user
+}
+
+func stringTraitPtr(traits map[string]interface{}, key string) *string {
+	v := getStringFromTraits(traits, key)
+	if v == "" {
+		return nil
+	}
+	return &v
+}
+
+func traitsToMetadata(traits map[string]interface{}) *json.RawMessage {
+	if len(traits) == 0 {
+		return nil
+	}
+
+	raw, err := json.Marshal(traits)
+	if err != nil {
+		return nil
+	}
+
+	msg := json.RawMessage(raw)
+	return &msg
+}
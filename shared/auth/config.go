@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+)
+
+// AuthMode selects which Provider implementation backs session validation.
+// Driven by the AUTH_MODE config value.
+type AuthMode string
+
+const (
+	AuthModeKratos AuthMode = "kratos"
+	AuthModeClerk  AuthMode = "clerk"
+)
+
+// Config is the AUTH_MODE-driven configuration consumed by NewProvider.
+type Config struct {
+	Mode AuthMode
+}
+
+// NewConfig builds Config from the raw AUTH_MODE value, so it can be wired
+// with the rest of ProviderSet. mode is the conf.Auth.Mode (or equivalent)
+// setting the bot service's conf package reads from the environment — wire
+// a provider for it alongside this package's ProviderSet.
+func NewConfig(mode string) Config {
+	return Config{Mode: AuthMode(mode)}
+}
+
+// PersonStore upserts the local person record associated with an identity on
+// first sight, so a Provider never has to know how persons are persisted.
+type PersonStore interface {
+	UpsertPerson(ctx context.Context, user *KratosUser) error
+}
+
+// NewProvider selects the concrete Provider implementation based on cfg.Mode,
+// so bot handlers only ever depend on the auth.Provider interface. Either
+// argument may be nil as long as it isn't the one selected by cfg.Mode.
+func NewProvider(cfg Config, kratos *KratosClient, clerk *ClerkClient) (Provider, error) {
+	switch cfg.Mode {
+	case "", AuthModeKratos:
+		if kratos == nil {
+			return nil, fmt.Errorf("auth: AUTH_MODE=kratos but no KratosClient configured")
+		}
+		return kratos, nil
+	case AuthModeClerk:
+		if clerk == nil {
+			return nil, fmt.Errorf("auth: AUTH_MODE=clerk but no ClerkClient configured")
+		}
+		return clerk, nil
+	default:
+		return nil, fmt.Errorf("auth: unknown AUTH_MODE %q", cfg.Mode)
+	}
+}
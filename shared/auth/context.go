@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+)
+
+// ctxKey is an unexported type so values this package stores in a
+// context.Context can never collide with keys set by other packages, even
+// ones that also happen to use the string "user".
+type ctxKey int
+
+const (
+	userCtxKey ctxKey = iota
+	internalTokenCtxKey
+)
+
+var errUserNotInContext = fmt.Errorf("user not found in context")
+
+// NewContext returns a copy of ctx carrying user, retrievable via
+// FromContext.
+func NewContext(ctx context.Context, user *KratosUser) context.Context {
+	return context.WithValue(ctx, userCtxKey, user)
+}
+
+// FromContext returns the KratosUser previously stored via NewContext, if
+// any.
+func FromContext(ctx context.Context) (*KratosUser, bool) {
+	user, ok := ctx.Value(userCtxKey).(*KratosUser)
+	return user, ok
+}
+
+// GetUserFromContext is a legacy alias for FromContext.
+//
+// Deprecated: use FromContext.
+func GetUserFromContext(ctx context.Context) (*KratosUser, bool) {
+	return FromContext(ctx)
+}
+
+// RequireUser returns the user stored on ctx, or an error if none is set.
+func RequireUser(ctx context.Context) (*KratosUser, error) {
+	user, ok := FromContext(ctx)
+	if !ok {
+		return nil, errUserNotInContext
+	}
+	return user, nil
+}
+
+// newInternalTokenContext returns a copy of ctx carrying the internal JWT
+// minted by ClerkClient.SessionMiddleware.
+func newInternalTokenContext(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, internalTokenCtxKey, token)
+}
+
+// GetInternalTokenFromContext returns the internal JWT minted by
+// ClerkClient.SessionMiddleware for the current request, if any.
+func GetInternalTokenFromContext(ctx context.Context) (string, bool) {
+	token, ok := ctx.Value(internalTokenCtxKey).(string)
+	return token, ok
+}
@@ -0,0 +1,136 @@
+// Package hooks fires outbound webhooks on login and session-refresh events,
+// carrying the identity's current upstream OIDC claims, so downstream
+// services (e.g. billing reacting to a subscription-plan change at the IdP)
+// don't have to wait for Kratos to refresh the identity on its own schedule.
+// It does not compare claims with earlier ones: every event is delivered.
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Event identifies why a webhook fired.
+type Event string
+
+const (
+	EventLogin          Event = "login"
+	EventSessionRefresh Event = "session_refresh"
+)
+
+const (
+	defaultMaxRetries = 5
+	defaultBaseDelay  = 500 * time.Millisecond
+)
+
+// Payload is the JSON body posted to every configured webhook.
+type Payload struct {
+	Event      Event       `json:"event"`
+	Identity   interface{} `json:"identity"`
+	Session    interface{} `json:"session"`
+	OIDCClaims interface{} `json:"oidc_claims"`
+	Flow       string      `json:"flow"`
+}
+
+// Config configures a single outbound webhook endpoint.
+type Config struct {
+	URL    string
+	Secret string // HMAC-SHA256 signing secret
+
+	// MaxRetries and BaseDelay control the exponential backoff applied
+	// between delivery attempts. Zero values fall back to 5 retries / 500ms.
+	MaxRetries int
+	BaseDelay  time.Duration
+}
+
+// Dispatcher fires configured webhooks on login/session-refresh events.
+type Dispatcher struct {
+	hooks  []Config
+	client *http.Client
+}
+
+// NewDispatcher builds a Dispatcher for the given webhooks. client may be
+// nil, in which case http.DefaultClient is used.
+func NewDispatcher(hooks []Config, client *http.Client) *Dispatcher {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Dispatcher{hooks: hooks, client: client}
+}
+
+// Fire delivers payload to every configured webhook, retrying each with
+// exponential backoff. It blocks until every webhook has either succeeded or
+// exhausted its retries, so callers that can't afford the latency should
+// invoke Fire from a goroutine.
+func (d *Dispatcher) Fire(ctx context.Context, payload Payload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("hooks: failed to marshal payload: %w", err)
+	}
+
+	var errs []error
+	for _, hook := range d.hooks {
+		if err := d.send(ctx, hook, body); err != nil {
+			errs = append(errs, fmt.Errorf("hooks: %s: %w", hook.URL, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (d *Dispatcher) send(ctx context.Context, hook Config, body []byte) error {
+	maxRetries := hook.MaxRetries
+	if maxRetries == 0 {
+		maxRetries = defaultMaxRetries
+	}
+	baseDelay := hook.BaseDelay
+	if baseDelay == 0 {
+		baseDelay = defaultBaseDelay
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(baseDelay * time.Duration(uint(1)<<uint(attempt-1))):
+			}
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Webhook-Signature", sign(hook.Secret, body))
+
+		resp, err := d.client.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return nil
+		}
+		lastErr = fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+
+	return lastErr
+}
+
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
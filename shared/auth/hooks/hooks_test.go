@@ -0,0 +1,93 @@
+package hooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDispatcherFireSignsPayload(t *testing.T) {
+	const secret = "s3cr3t"
+
+	var gotSig, gotBody string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+		gotSig = r.Header.Get("X-Webhook-Signature")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	d := NewDispatcher([]Config{{URL: srv.URL, Secret: secret}}, nil)
+
+	payload := Payload{Event: EventLogin, Flow: "flow-1"}
+	if err := d.Fire(context.Background(), payload); err != nil {
+		t.Fatalf("Fire: %v", err)
+	}
+
+	wantBody, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if gotBody != string(wantBody) {
+		t.Errorf("body = %q, want %q", gotBody, wantBody)
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(wantBody)
+	wantSig := hex.EncodeToString(mac.Sum(nil))
+	if gotSig != wantSig {
+		t.Errorf("signature = %q, want %q", gotSig, wantSig)
+	}
+}
+
+func TestDispatcherFireRetriesOnFailureThenSucceeds(t *testing.T) {
+	var attempts int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) < 3 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	d := NewDispatcher([]Config{{
+		URL:        srv.URL,
+		MaxRetries: 5,
+		BaseDelay:  time.Millisecond,
+	}}, nil)
+
+	if err := d.Fire(context.Background(), Payload{Event: EventSessionRefresh}); err != nil {
+		t.Fatalf("Fire: %v", err)
+	}
+
+	if got := atomic.LoadInt32(&attempts); got != 3 {
+		t.Errorf("attempts = %d, want 3", got)
+	}
+}
+
+func TestDispatcherFireReturnsErrorAfterExhaustingRetries(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	d := NewDispatcher([]Config{{
+		URL:        srv.URL,
+		MaxRetries: 1,
+		BaseDelay:  time.Millisecond,
+	}}, nil)
+
+	if err := d.Fire(context.Background(), Payload{Event: EventLogin}); err == nil {
+		t.Fatal("Fire: expected error after exhausting retries, got nil")
+	}
+}
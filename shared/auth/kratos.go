@@ -4,18 +4,30 @@ import (
 	"context"
 	"fmt"
 	"net/http"
-	"strings"
 	"time"
 
+	jwtlib "github.com/golang-jwt/jwt/v5"
 	client "github.com/ory/kratos-client-go"
+	gocache "github.com/patrickmn/go-cache"
+
+	"github.com/tradingbot/platform/shared/auth/hooks"
 )
 
+// defaultVerificationCacheTTL bounds how long an identity's email
+// verification status is trusted before fetchEmailVerified is called again.
+const defaultVerificationCacheTTL = 2 * time.Minute
+
 // Kratos Client
 type KratosClient struct {
-	admin  *client.APIClient
-	public *client.APIClient
+	admin       *client.APIClient
+	public      *client.APIClient
+	hooks       *hooks.Dispatcher
+	verifyCache *gocache.Cache
+	cache       *sessionCache
 }
 
+var _ Provider = (*KratosClient)(nil)
+
 type KratosUser struct {
 	ID               string      `json:"id"`
 	Email            string      `json:"email"`
@@ -30,6 +42,29 @@ type KratosUser struct {
 	CreatedAt        time.Time   `json:"created_at"`
 	UpdatedAt        time.Time   `json:"updated_at"`
 	Traits           interface{} `json:"traits"`
+
+	// OIDCClaims holds the decoded claims (email, email_verified,
+	// preferred_username, locale, hd, groups, ...) from the last upstream
+	// OIDC login, as persisted by Kratos alongside the identity's oidc
+	// credentials.
+	OIDCClaims      map[string]interface{} `json:"oidc_claims,omitempty"`
+	OIDCCredentials *OIDCCredentials       `json:"-"`
+
+	// SessionID is the Kratos session this user was resolved from. Set by
+	// ValidateSession; GetUser leaves it empty unless it returns an identity
+	// cache entry that ValidateSession filled. Used for structured logging by
+	// the Server middleware.
+	SessionID string `json:"-"`
+}
+
+// OIDCCredentials are the raw tokens Kratos stored for an identity's last
+// OIDC login, as configured by the provider's `id_token`/`access_token`
+// retention settings.
+type OIDCCredentials struct {
+	Provider     string
+	IDToken      string
+	AccessToken  string
+	RefreshToken string
 }
 
 func NewKratosClient(adminURL, publicURL string) *KratosClient {
@@ -44,94 +79,205 @@ func NewKratosClient(adminURL, publicURL string) *KratosClient {
 	}
 
 	return &KratosClient{
-		admin:  client.NewAPIClient(adminConfig),
-		public: client.NewAPIClient(publicConfig),
+		admin:       client.NewAPIClient(adminConfig),
+		public:      client.NewAPIClient(publicConfig),
+		verifyCache: gocache.New(defaultVerificationCacheTTL, 2*defaultVerificationCacheTTL),
+		cache:       newSessionCache(0, 0),
 	}
 }
 
+// WithHooks attaches a webhook dispatcher so that ValidateSession, each time
+// it loads a session from Kratos (a cache miss) whose identity has OIDC
+// claims, fires a session-refresh event carrying those claims to downstream
+// services.
+func (k *KratosClient) WithHooks(d *hooks.Dispatcher) *KratosClient {
+	k.hooks = d
+	return k
+}
+
+// WithCacheTTLs overrides the default session (~5m) and identity (~1h)
+// cache TTLs used by ValidateSession/GetUser.
+func (k *KratosClient) WithCacheTTLs(sessionTTL, identityTTL time.Duration) *KratosClient {
+	k.cache = newSessionCache(sessionTTL, identityTTL)
+	return k
+}
+
+// Purge clears every cached session, identity, and email-verification entry.
+// Intended for tests.
+func (k *KratosClient) Purge() {
+	k.cache.purge()
+	k.verifyCache.Flush()
+}
+
 // Session Validation
 func (k *KratosClient) ValidateSession(ctx context.Context, sessionToken string) (*KratosUser, error) {
 	if sessionToken == "" {
 		return nil, fmt.Errorf("session token is required")
 	}
 
-	// Проверяем сессию через Kratos
-	session, resp, err := k.public.FrontendAPI.ToSession(ctx).
-		XSessionToken(sessionToken).
-		Execute()
+	return k.cache.getSession(sessionToken, func() (*KratosUser, string, error) {
+		// Проверяем сессию через Kratos
+		session, resp, err := k.public.FrontendAPI.ToSession(ctx).
+			XSessionToken(sessionToken).
+			Execute()
 
-	if err != nil {
-		return nil, fmt.Errorf("session validation failed: %w", err)
+		if err != nil {
+			return nil, "", fmt.Errorf("session validation failed: %w", err)
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, "", fmt.Errorf("invalid session: status %d", resp.StatusCode)
+		}
+
+		if !session.GetActive() {
+			return nil, "", fmt.Errorf("session is not active")
+		}
+
+		// Преобразуем в наш формат
+		user := &KratosUser{
+			ID:        session.Identity.GetId(),
+			Active:    session.GetActive(),
+			CreatedAt: session.Identity.GetCreatedAt(),
+			UpdatedAt: session.Identity.GetUpdatedAt(),
+			SessionID: session.GetId(),
+		}
+
+		// Извлекаем traits безопасно
+		if traits := session.Identity.GetTraits(); traits != nil {
+			user.Traits = traits
+			user.Email = getStringFromTraits(traits, "email")
+			user.Username = getStringFromTraits(traits, "username")
+			user.FirstName = getStringFromTraits(traits, "first_name")
+			user.LastName = getStringFromTraits(traits, "last_name")
+			user.Phone = getStringFromTraits(traits, "phone")
+			user.SubscriptionPlan = getStringFromTraits(traits, "subscription_plan")
+			user.Avatar = getStringFromTraits(traits, "avatar")
+		}
+
+		user.EmailVerified = k.isEmailVerified(ctx, session.Identity.GetId())
+		user.OIDCClaims, user.OIDCCredentials = k.loadOIDCClaims(ctx, session.Identity.GetId())
+
+		if k.hooks != nil && user.OIDCClaims != nil {
+			go k.notifyHooks(hooks.EventSessionRefresh, session.Identity, session, user.OIDCClaims, "")
+		}
+
+		return user, session.GetId(), nil
+	})
+}
+
+// loadOIDCClaims reads the identity's oidc credentials via the admin API and
+// decodes the last persisted id_token, so callers get at the upstream IdP's
+// claims (email, groups, ...) without waiting for Kratos to refresh them.
+func (k *KratosClient) loadOIDCClaims(ctx context.Context, identityID string) (map[string]interface{}, *OIDCCredentials) {
+	identity, resp, err := k.admin.IdentityAPI.GetIdentity(ctx, identityID).
+		IncludeCredential([]string{"oidc"}).
+		Execute()
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return nil, nil
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("invalid session: status %d", resp.StatusCode)
+	creds := identity.GetCredentials()
+	oidc, ok := creds["oidc"]
+	if !ok {
+		return nil, nil
 	}
 
-	if !session.GetActive() {
-		return nil, fmt.Errorf("session is not active")
+	cfg, ok := oidc.GetConfig().(map[string]interface{})
+	if !ok {
+		return nil, nil
 	}
 
-	// Преобразуем в наш формат
-	user := &KratosUser{
-		ID:        session.Identity.GetId(),
-		Active:    session.GetActive(),
-		CreatedAt: session.Identity.GetCreatedAt(),
-		UpdatedAt: session.Identity.GetUpdatedAt(),
+	providers, _ := cfg["providers"].([]interface{})
+	if len(providers) == 0 {
+		return nil, nil
 	}
 
-	// Извлекаем traits безопасно
-	if traits := session.Identity.GetTraits(); traits != nil {
-		user.Traits = traits
-		user.Email = getStringFromTraits(traits, "email")
-		user.Username = getStringFromTraits(traits, "username")
-		user.FirstName = getStringFromTraits(traits, "first_name")
-		user.LastName = getStringFromTraits(traits, "last_name")
-		user.Phone = getStringFromTraits(traits, "phone")
-		user.SubscriptionPlan = getStringFromTraits(traits, "subscription_plan")
-		user.Avatar = getStringFromTraits(traits, "avatar")
+	// Берём последнего провайдера — он соответствует самому недавнему входу.
+	provider, _ := providers[len(providers)-1].(map[string]interface{})
+	if provider == nil {
+		return nil, nil
 	}
 
-	// Проверяем верификацию email через recovery addresses
-	user.EmailVerified = k.isEmailVerified(ctx, session.Identity.GetId())
+	credentials := &OIDCCredentials{
+		Provider:     getStringFromTraits(provider, "provider"),
+		IDToken:      getStringFromTraits(provider, "initial_id_token"),
+		AccessToken:  getStringFromTraits(provider, "initial_access_token"),
+		RefreshToken: getStringFromTraits(provider, "initial_refresh_token"),
+	}
 
-	return user, nil
+	return decodeOIDCClaims(credentials.IDToken), credentials
 }
 
-// User Management
-func (k *KratosClient) GetUser(ctx context.Context, userID string) (*KratosUser, error) {
-	identity, resp, err := k.admin.IdentityAPI.GetIdentity(ctx, userID).
-		Execute()
+// decodeOIDCClaims decodes an id_token's claims without verifying its
+// signature: Kratos already verified it against the provider's JWKS at login
+// time, so this is just unpacking what Kratos persisted.
+func decodeOIDCClaims(idToken string) map[string]interface{} {
+	if idToken == "" {
+		return nil
+	}
 
+	token, _, err := jwtlib.NewParser().ParseUnverified(idToken, jwtlib.MapClaims{})
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user: %w", err)
+		return nil
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("user not found: status %d", resp.StatusCode)
+	claims, ok := token.Claims.(jwtlib.MapClaims)
+	if !ok {
+		return nil
 	}
 
-	user := &KratosUser{
-		ID:        identity.GetId(),
-		CreatedAt: identity.GetCreatedAt(),
-		UpdatedAt: identity.GetUpdatedAt(),
-	}
+	return map[string]interface{}(claims)
+}
 
-	// Извлекаем traits безопасно
-	if traits := identity.GetTraits(); traits != nil {
-		user.Traits = traits
-		user.Email = getStringFromTraits(traits, "email")
-		user.Username = getStringFromTraits(traits, "username")
-		user.FirstName = getStringFromTraits(traits, "first_name")
-		user.LastName = getStringFromTraits(traits, "last_name")
-		user.Phone = getStringFromTraits(traits, "phone")
-		user.SubscriptionPlan = getStringFromTraits(traits, "subscription_plan")
-		user.Avatar = getStringFromTraits(traits, "avatar")
-	}
+// notifyHooks fires the configured webhooks for event, discarding any
+// delivery error rather than surfacing it since a webhook outage must never
+// block session validation.
+func (k *KratosClient) notifyHooks(event hooks.Event, identity, session interface{}, oidcClaims interface{}, flow string) {
+	_ = k.hooks.Fire(context.Background(), hooks.Payload{
+		Event:      event,
+		Identity:   identity,
+		Session:    session,
+		OIDCClaims: oidcClaims,
+		Flow:       flow,
+	})
+}
+
+// User Management
+func (k *KratosClient) GetUser(ctx context.Context, userID string) (*KratosUser, error) {
+	return k.cache.getIdentity(userID, func() (*KratosUser, error) {
+		identity, resp, err := k.admin.IdentityAPI.GetIdentity(ctx, userID).
+			Execute()
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to get user: %w", err)
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("user not found: status %d", resp.StatusCode)
+		}
+
+		user := &KratosUser{
+			ID:        identity.GetId(),
+			CreatedAt: identity.GetCreatedAt(),
+			UpdatedAt: identity.GetUpdatedAt(),
+		}
+
+		// Извлекаем traits безопасно
+		if traits := identity.GetTraits(); traits != nil {
+			user.Traits = traits
+			user.Email = getStringFromTraits(traits, "email")
+			user.Username = getStringFromTraits(traits, "username")
+			user.FirstName = getStringFromTraits(traits, "first_name")
+			user.LastName = getStringFromTraits(traits, "last_name")
+			user.Phone = getStringFromTraits(traits, "phone")
+			user.SubscriptionPlan = getStringFromTraits(traits, "subscription_plan")
+			user.Avatar = getStringFromTraits(traits, "avatar")
+		}
 
-	user.EmailVerified = k.isEmailVerified(ctx, identity.GetId())
+		user.EmailVerified = k.isEmailVerified(ctx, identity.GetId())
 
-	return user, nil
+		return user, nil
+	})
 }
 
 func (k *KratosClient) UpdateUser(ctx context.Context, userID string, traits map[string]interface{}) (*KratosUser, error) {
@@ -151,6 +297,9 @@ func (k *KratosClient) UpdateUser(ctx context.Context, userID string, traits map
 		return nil, fmt.Errorf("failed to update user: status %d", resp.StatusCode)
 	}
 
+	k.cache.invalidateIdentity(identity.GetId())
+	k.verifyCache.Delete(identity.GetId())
+
 	return k.GetUser(ctx, identity.GetId())
 }
 
@@ -165,11 +314,13 @@ func (k *KratosClient) DeleteUser(ctx context.Context, userID string) error {
 		return fmt.Errorf("failed to delete user: status %d", resp.StatusCode)
 	}
 
+	k.cache.invalidateIdentity(userID)
+
 	return nil
 }
 
 // Sessions Management
-func (k *KratosClient) ListUserSessions(ctx context.Context, userID string) ([]client.Session, error) {
+func (k *KratosClient) ListUserSessions(ctx context.Context, userID string) ([]Session, error) {
 	sessions, resp, err := k.admin.IdentityAPI.ListIdentitySessions(ctx, userID).Execute()
 
 	if err != nil {
@@ -180,7 +331,17 @@ func (k *KratosClient) ListUserSessions(ctx context.Context, userID string) ([]c
 		return nil, fmt.Errorf("failed to list sessions: status %d", resp.StatusCode)
 	}
 
-	return sessions, nil
+	result := make([]Session, 0, len(sessions))
+	for _, s := range sessions {
+		result = append(result, Session{
+			ID:         s.GetId(),
+			IdentityID: s.Identity.GetId(),
+			Active:     s.GetActive(),
+			ExpiresAt:  s.GetExpiresAt(),
+		})
+	}
+
+	return result, nil
 }
 
 func (k *KratosClient) RevokeSession(ctx context.Context, sessionID string) error {
@@ -194,36 +355,40 @@ func (k *KratosClient) RevokeSession(ctx context.Context, sessionID string) erro
 		return fmt.Errorf("failed to revoke session: status %d", resp.StatusCode)
 	}
 
+	k.cache.invalidateSessionID(sessionID)
+
 	return nil
 }
 
 // Helper functions
+
+// isEmailVerified is the single source of truth for email verification: an
+// identity is verified only if it has a VerifiableAddress with via=email
+// that Kratos itself has marked verified. Having a recovery address is not
+// sufficient — a recovery address can exist long before the owner ever
+// confirms it. Results are cached per identity ID for a short TTL so
+// ValidateSession doesn't pay for an extra admin API round-trip on every
+// request.
 func (k *KratosClient) isEmailVerified(ctx context.Context, userID string) bool {
-	// В Kratos проверка верификации email происходит через recovery addresses
-	// или через verification addresses (зависит от версии)
+	if cached, ok := k.verifyCache.Get(userID); ok {
+		return cached.(bool)
+	}
+
+	verified := k.fetchEmailVerified(ctx, userID)
+	k.verifyCache.Set(userID, verified, gocache.DefaultExpiration)
+
+	return verified
+}
 
-	// Простой способ - проверяем через identity metadata или verifiable addresses
+func (k *KratosClient) fetchEmailVerified(ctx context.Context, userID string) bool {
 	identity, resp, err := k.admin.IdentityAPI.GetIdentity(ctx, userID).Execute()
 	if err != nil || resp.StatusCode != http.StatusOK {
 		return false
 	}
 
-	// Проверяем verifiable addresses если они есть
-	if addresses := identity.GetVerifiableAddresses(); len(addresses) > 0 {
-		for _, addr := range addresses {
-			if addr.GetVia() == "email" && addr.GetVerified() {
-				return true
-			}
-		}
-	}
-
-	// Альтернативно проверяем recovery addresses
-	if addresses := identity.GetRecoveryAddresses(); len(addresses) > 0 {
-		for _, addr := range addresses {
-			if addr.GetVia() == "email" {
-				// Если recovery address существует, считаем email верифицированным
-				return true
-			}
+	for _, addr := range identity.GetVerifiableAddresses() {
+		if addr.GetVia() == "email" && addr.GetVerified() {
+			return true
 		}
 	}
 
@@ -267,43 +432,21 @@ func (k *KratosClient) SessionMiddleware() func(http.Handler) http.Handler {
 			}
 
 			// Добавляем пользователя в контекст
-			ctx := context.WithValue(r.Context(), "user", user)
+			ctx := NewContext(r.Context(), user)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
 func (k *KratosClient) extractSessionToken(r *http.Request) string {
-	// Проверяем заголовок Authorization
-	if auth := r.Header.Get("Authorization"); auth != "" {
-		if strings.HasPrefix(auth, "Bearer ") {
-			return strings.TrimPrefix(auth, "Bearer ")
-		}
-	}
-
-	// Проверяем заголовок X-Session-Token
-	if token := r.Header.Get("X-Session-Token"); token != "" {
+	if token := extractSessionToken(r); token != "" {
 		return token
 	}
 
-	// Проверяем cookie
+	// Проверяем cookie, специфичную для Kratos
 	if cookie, err := r.Cookie("ory_kratos_session"); err == nil {
 		return cookie.Value
 	}
 
 	return ""
 }
-
-// Utility функции для извлечения пользователя из контекста
-func GetUserFromContext(ctx context.Context) (*KratosUser, bool) {
-	user, ok := ctx.Value("user").(*KratosUser)
-	return user, ok
-}
-
-func RequireUser(ctx context.Context) (*KratosUser, error) {
-	user, ok := GetUserFromContext(ctx)
-	if !ok {
-		return nil, fmt.Errorf("user not found in context")
-	}
-	return user, nil
-}
@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Provider abstracts the identity backend behind session validation and user
+// management so that bot handlers never need to know whether sessions are
+// backed by Kratos or Clerk. Selection between concrete implementations is
+// driven by Config.Mode (see NewProvider).
+type Provider interface {
+	ValidateSession(ctx context.Context, sessionToken string) (*KratosUser, error)
+	GetUser(ctx context.Context, userID string) (*KratosUser, error)
+	UpdateUser(ctx context.Context, userID string, traits map[string]interface{}) (*KratosUser, error)
+	DeleteUser(ctx context.Context, userID string) error
+	ListUserSessions(ctx context.Context, userID string) ([]Session, error)
+	RevokeSession(ctx context.Context, sessionID string) error
+	SessionMiddleware() func(http.Handler) http.Handler
+}
+
+// Session is a backend-agnostic view of an identity session, shared by every
+// Provider implementation so callers don't leak Kratos- or Clerk-specific
+// types.
+type Session struct {
+	ID         string
+	IdentityID string
+	Active     bool
+	ExpiresAt  time.Time
+}
+
+// extractSessionToken pulls a session token out of the transport-agnostic
+// locations every Provider accepts: the Authorization header, the
+// X-Session-Token header, or a provider-specific cookie (checked by callers).
+func extractSessionToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		if strings.HasPrefix(auth, "Bearer ") {
+			return strings.TrimPrefix(auth, "Bearer ")
+		}
+	}
+
+	if token := r.Header.Get("X-Session-Token"); token != "" {
+		return token
+	}
+
+	return ""
+}
+
+// hashToken hashes a raw session token so it's never held in memory (cache
+// keys, logs) in a form that can be replayed against Kratos/Clerk.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,205 @@
+package auth
+
+import (
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2/expirable"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	defaultSessionCacheSize = 10_000
+	defaultSessionCacheTTL  = 5 * time.Minute
+	defaultIdentityCacheTTL = 1 * time.Hour
+)
+
+var (
+	sessionCacheHits = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_session_cache_hits_total",
+		Help: "Number of KratosClient session/identity cache hits, by cache.",
+	}, []string{"cache"})
+
+	sessionCacheMisses = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_session_cache_misses_total",
+		Help: "Number of KratosClient session/identity cache misses, by cache.",
+	}, []string{"cache"})
+
+	sessionCacheUpstreamLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "auth_session_cache_upstream_latency_seconds",
+		Help: "Latency of the upstream Kratos call made on a cache miss, by cache.",
+	}, []string{"cache"})
+)
+
+// sessionCache caches validated sessions (keyed by a hash of the session
+// token) and identities (keyed by identity ID) with independent TTLs.
+// Concurrent lookups for the same key are collapsed via singleflight so a
+// burst of requests for one token only ever reaches Kratos once.
+//
+// A single identity can have several cached sessions at once (multiple
+// devices, multiple tokens), so identitySessions indexes identity ID ->
+// the set of token-hash keys caching that identity, letting
+// invalidateIdentity evict every live session for that identity instead of
+// just the identity-lookup cache. The index is kept in sync via the
+// sessions LRU's eviction callback, so natural TTL expiry and explicit
+// removal both clean it up.
+type sessionCache struct {
+	sessions   *lru.LRU[string, *KratosUser]
+	identities *lru.LRU[string, *KratosUser]
+	sessionIDs *lru.LRU[string, string] // Kratos session ID -> token hash
+
+	mu               sync.Mutex
+	identitySessions map[string]map[string]struct{} // identity ID -> token-hash keys
+
+	group singleflight.Group
+}
+
+func newSessionCache(sessionTTL, identityTTL time.Duration) *sessionCache {
+	if sessionTTL <= 0 {
+		sessionTTL = defaultSessionCacheTTL
+	}
+	if identityTTL <= 0 {
+		identityTTL = defaultIdentityCacheTTL
+	}
+
+	c := &sessionCache{
+		identitySessions: make(map[string]map[string]struct{}),
+	}
+
+	c.sessions = lru.NewLRU[string, *KratosUser](defaultSessionCacheSize, c.onSessionEvicted, sessionTTL)
+	c.identities = lru.NewLRU[string, *KratosUser](defaultSessionCacheSize, nil, identityTTL)
+	c.sessionIDs = lru.NewLRU[string, string](defaultSessionCacheSize, nil, sessionTTL)
+
+	return c
+}
+
+// onSessionEvicted keeps identitySessions in sync whenever a session cache
+// entry goes away, whether by TTL expiry, capacity eviction, or an explicit
+// Remove call.
+func (c *sessionCache) onSessionEvicted(key string, user *KratosUser) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	keys := c.identitySessions[user.ID]
+	delete(keys, key)
+	if len(keys) == 0 {
+		delete(c.identitySessions, user.ID)
+	}
+}
+
+func (c *sessionCache) trackIdentitySession(identityID, key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	keys, ok := c.identitySessions[identityID]
+	if !ok {
+		keys = make(map[string]struct{})
+		c.identitySessions[identityID] = keys
+	}
+	keys[key] = struct{}{}
+}
+
+// getSession returns the cached user for sessionToken, calling fetch on a
+// miss. fetch also returns the Kratos session ID so RevokeSession can later
+// invalidate this entry without needing the raw token.
+func (c *sessionCache) getSession(sessionToken string, fetch func() (*KratosUser, string, error)) (*KratosUser, error) {
+	key := hashToken(sessionToken)
+
+	if user, ok := c.sessions.Get(key); ok {
+		sessionCacheHits.WithLabelValues("session").Inc()
+		return user, nil
+	}
+	sessionCacheMisses.WithLabelValues("session").Inc()
+
+	v, err, _ := c.group.Do(key, func() (interface{}, error) {
+		start := time.Now()
+		user, sessionID, err := fetch()
+		sessionCacheUpstreamLatency.WithLabelValues("session").Observe(time.Since(start).Seconds())
+		if err != nil {
+			return nil, err
+		}
+
+		c.sessions.Add(key, user)
+		c.identities.Add(user.ID, user)
+		c.trackIdentitySession(user.ID, key)
+		if sessionID != "" {
+			c.sessionIDs.Add(sessionID, key)
+		}
+
+		return user, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return v.(*KratosUser), nil
+}
+
+// getIdentity returns the cached user for identityID, calling fetch on a
+// miss.
+func (c *sessionCache) getIdentity(identityID string, fetch func() (*KratosUser, error)) (*KratosUser, error) {
+	if user, ok := c.identities.Get(identityID); ok {
+		sessionCacheHits.WithLabelValues("identity").Inc()
+		return user, nil
+	}
+	sessionCacheMisses.WithLabelValues("identity").Inc()
+
+	v, err, _ := c.group.Do("identity:"+identityID, func() (interface{}, error) {
+		start := time.Now()
+		user, err := fetch()
+		sessionCacheUpstreamLatency.WithLabelValues("identity").Observe(time.Since(start).Seconds())
+		if err != nil {
+			return nil, err
+		}
+
+		c.identities.Add(identityID, user)
+
+		return user, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return v.(*KratosUser), nil
+}
+
+// invalidateIdentity drops the cached identity entry AND every live session
+// cached for that identity, used after UpdateUser and DeleteUser. Without
+// this, a deleted/updated identity would keep being served out of the
+// session cache until its TTL naturally expired.
+func (c *sessionCache) invalidateIdentity(identityID string) {
+	c.identities.Remove(identityID)
+
+	c.mu.Lock()
+	keys := make([]string, 0, len(c.identitySessions[identityID]))
+	for key := range c.identitySessions[identityID] {
+		keys = append(keys, key)
+	}
+	c.mu.Unlock()
+
+	for _, key := range keys {
+		c.sessions.Remove(key)
+	}
+}
+
+// invalidateSessionID drops the session cache entry for the given Kratos
+// session ID, used after RevokeSession.
+func (c *sessionCache) invalidateSessionID(sessionID string) {
+	if key, ok := c.sessionIDs.Get(sessionID); ok {
+		c.sessions.Remove(key)
+		c.sessionIDs.Remove(sessionID)
+	}
+}
+
+// purge clears every cached entry. Intended for tests.
+func (c *sessionCache) purge() {
+	c.sessions.Purge()
+	c.identities.Purge()
+	c.sessionIDs.Purge()
+
+	c.mu.Lock()
+	c.identitySessions = make(map[string]map[string]struct{})
+	c.mu.Unlock()
+}
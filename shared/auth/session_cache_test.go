@@ -0,0 +1,164 @@
+package auth
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSessionCacheGetSessionCollapsesConcurrentMisses(t *testing.T) {
+	c := newSessionCache(time.Minute, time.Minute)
+
+	var calls int32
+	fetch := func() (*KratosUser, string, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(10 * time.Millisecond)
+		return &KratosUser{ID: "user-1"}, "session-1", nil
+	}
+
+	const n = 20
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func() {
+			defer wg.Done()
+			if _, err := c.getSession("token", fetch); err != nil {
+				t.Errorf("getSession: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("fetch called %d times, want 1", got)
+	}
+}
+
+func TestSessionCacheGetSessionCachesResult(t *testing.T) {
+	c := newSessionCache(time.Minute, time.Minute)
+
+	var calls int
+	fetch := func() (*KratosUser, string, error) {
+		calls++
+		return &KratosUser{ID: "user-1"}, "session-1", nil
+	}
+
+	if _, err := c.getSession("token", fetch); err != nil {
+		t.Fatalf("getSession: %v", err)
+	}
+	if _, err := c.getSession("token", fetch); err != nil {
+		t.Fatalf("getSession: %v", err)
+	}
+
+	if calls != 1 {
+		t.Errorf("fetch called %d times, want 1", calls)
+	}
+}
+
+func TestSessionCacheGetSessionExpiresAfterTTL(t *testing.T) {
+	c := newSessionCache(20*time.Millisecond, time.Minute)
+
+	var calls int32
+	fetch := func() (*KratosUser, string, error) {
+		atomic.AddInt32(&calls, 1)
+		return &KratosUser{ID: "user-1"}, "session-1", nil
+	}
+
+	if _, err := c.getSession("token", fetch); err != nil {
+		t.Fatalf("getSession: %v", err)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	if _, err := c.getSession("token", fetch); err != nil {
+		t.Fatalf("getSession: %v", err)
+	}
+
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Errorf("fetch called %d times after TTL expiry, want 2", got)
+	}
+}
+
+func TestSessionCacheInvalidateIdentityEvictsLiveSessions(t *testing.T) {
+	c := newSessionCache(time.Minute, time.Minute)
+
+	for i := 0; i < 3; i++ {
+		token := fmt.Sprintf("token-%d", i)
+		_, err := c.getSession(token, func() (*KratosUser, string, error) {
+			return &KratosUser{ID: "user-1"}, fmt.Sprintf("session-%d", i), nil
+		})
+		if err != nil {
+			t.Fatalf("getSession: %v", err)
+		}
+	}
+
+	if _, ok := c.sessions.Get(hashToken("token-0")); !ok {
+		t.Fatal("expected token-0 to be cached before invalidation")
+	}
+
+	c.invalidateIdentity("user-1")
+
+	for i := 0; i < 3; i++ {
+		key := hashToken(fmt.Sprintf("token-%d", i))
+		if _, ok := c.sessions.Get(key); ok {
+			t.Errorf("session for token-%d still cached after invalidateIdentity", i)
+		}
+	}
+
+	if _, ok := c.identities.Get("user-1"); ok {
+		t.Error("identity still cached after invalidateIdentity")
+	}
+
+	c.mu.Lock()
+	remaining := len(c.identitySessions["user-1"])
+	c.mu.Unlock()
+	if remaining != 0 {
+		t.Errorf("identitySessions[user-1] has %d stale keys, want 0", remaining)
+	}
+}
+
+func TestSessionCacheInvalidateSessionID(t *testing.T) {
+	c := newSessionCache(time.Minute, time.Minute)
+
+	_, err := c.getSession("token", func() (*KratosUser, string, error) {
+		return &KratosUser{ID: "user-1"}, "session-1", nil
+	})
+	if err != nil {
+		t.Fatalf("getSession: %v", err)
+	}
+
+	c.invalidateSessionID("session-1")
+
+	if _, ok := c.sessions.Get(hashToken("token")); ok {
+		t.Error("session still cached after invalidateSessionID")
+	}
+}
+
+func TestSessionCachePurgeClearsEverything(t *testing.T) {
+	c := newSessionCache(time.Minute, time.Minute)
+
+	_, err := c.getSession("token", func() (*KratosUser, string, error) {
+		return &KratosUser{ID: "user-1"}, "session-1", nil
+	})
+	if err != nil {
+		t.Fatalf("getSession: %v", err)
+	}
+
+	c.purge()
+
+	if _, ok := c.sessions.Get(hashToken("token")); ok {
+		t.Error("session still cached after purge")
+	}
+	if _, ok := c.identities.Get("user-1"); ok {
+		t.Error("identity still cached after purge")
+	}
+
+	c.mu.Lock()
+	n := len(c.identitySessions)
+	c.mu.Unlock()
+	if n != 0 {
+		t.Errorf("identitySessions has %d entries after purge, want 0", n)
+	}
+}
@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	client "github.com/ory/kratos-client-go"
+)
+
+// StartEmailVerification initiates a Kratos verification flow for email
+// through the public API's native (non-browser) flow, returning the flow ID
+// callers pass to SubmitVerificationCode/ResendVerification.
+func (k *KratosClient) StartEmailVerification(ctx context.Context, email string) (string, error) {
+	flow, resp, err := k.public.FrontendAPI.CreateNativeVerificationFlow(ctx).Execute()
+	if err != nil {
+		return "", fmt.Errorf("failed to start verification flow: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to start verification flow: status %d", resp.StatusCode)
+	}
+
+	_, resp, err = k.public.FrontendAPI.UpdateVerificationFlow(ctx).
+		Flow(flow.GetId()).
+		UpdateVerificationFlowBody(client.UpdateVerificationFlowBody{
+			UpdateVerificationFlowWithCodeMethod: &client.UpdateVerificationFlowWithCodeMethod{
+				Method: "code",
+				Email:  &email,
+			},
+		}).
+		Execute()
+	if err != nil {
+		return "", fmt.Errorf("failed to submit verification email: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to submit verification email: status %d", resp.StatusCode)
+	}
+
+	return flow.GetId(), nil
+}
+
+// SubmitVerificationCode completes the verification flow started by
+// StartEmailVerification with the code the user received by email.
+// identityID is the identity the flow belongs to, used to evict
+// isEmailVerified's cache so ValidateSession/GetUser see the result
+// immediately instead of waiting out defaultVerificationCacheTTL.
+func (k *KratosClient) SubmitVerificationCode(ctx context.Context, flowID, code, identityID string) error {
+	_, resp, err := k.public.FrontendAPI.UpdateVerificationFlow(ctx).
+		Flow(flowID).
+		UpdateVerificationFlowBody(client.UpdateVerificationFlowBody{
+			UpdateVerificationFlowWithCodeMethod: &client.UpdateVerificationFlowWithCodeMethod{
+				Method: "code",
+				Code:   &code,
+			},
+		}).
+		Execute()
+	if err != nil {
+		return fmt.Errorf("failed to submit verification code: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("invalid or expired verification code: status %d", resp.StatusCode)
+	}
+
+	k.verifyCache.Delete(identityID)
+
+	return nil
+}
+
+// ResendVerification restarts the code step of an existing verification
+// flow, e.g. after the user's code expired.
+func (k *KratosClient) ResendVerification(ctx context.Context, flowID string) error {
+	resend := "true"
+
+	_, resp, err := k.public.FrontendAPI.UpdateVerificationFlow(ctx).
+		Flow(flowID).
+		UpdateVerificationFlowBody(client.UpdateVerificationFlowBody{
+			UpdateVerificationFlowWithCodeMethod: &client.UpdateVerificationFlowWithCodeMethod{
+				Method: "code",
+				Resend: &resend,
+			},
+		}).
+		Execute()
+	if err != nil {
+		return fmt.Errorf("failed to resend verification code: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to resend verification code: status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// RequireVerifiedEmail 403s any authenticated user whose email isn't
+// verified. Chain it after SessionMiddleware on trading endpoints that must
+// not be reachable by an unverified account. It only reads the *KratosUser
+// FromContext left by SessionMiddleware, so it works the same whether that
+// context came from KratosClient or ClerkClient.
+func RequireVerifiedEmail(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := FromContext(r.Context())
+		if !ok {
+			http.Error(w, "Invalid session", http.StatusUnauthorized)
+			return
+		}
+
+		if !user.EmailVerified {
+			http.Error(w, "Email verification required", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// MigrateEmailVerifiedTrait removes the legacy traits.verified /
+// traits.email_verified boolean some deployments incorrectly duplicated into
+// traits, now that EmailVerified is derived solely from
+// VerifiableAddresses. Safe to call repeatedly; a no-op once the trait is
+// already gone.
+func (k *KratosClient) MigrateEmailVerifiedTrait(ctx context.Context, identityID string) error {
+	identity, resp, err := k.admin.IdentityAPI.GetIdentity(ctx, identityID).Execute()
+	if err != nil {
+		return fmt.Errorf("failed to get identity: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to get identity: status %d", resp.StatusCode)
+	}
+
+	traits, ok := identity.GetTraits().(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	_, hasVerified := traits["verified"]
+	_, hasEmailVerified := traits["email_verified"]
+	if !hasVerified && !hasEmailVerified {
+		return nil
+	}
+
+	delete(traits, "verified")
+	delete(traits, "email_verified")
+
+	_, err = k.UpdateUser(ctx, identityID, traits)
+	return err
+}
@@ -0,0 +1,15 @@
+package auth
+
+import "github.com/google/wire"
+
+// ProviderSet exposes the auth package to wire so NewKratosClient is
+// constructed once and reused — as the concrete *KratosClient where needed,
+// and as the auth.Provider both the gRPC and HTTP transports authenticate
+// through via Server/SessionMiddleware.
+//
+// NewConfig turns AUTH_MODE into the Config NewProvider switches on, and
+// NewClerkClient is included so AUTH_MODE=clerk actually resolves through
+// the graph instead of leaving *ClerkClient unbound. NewClerkClient's own
+// ClerkConfig/PersonStore arguments are expected to come from the service's
+// conf/data providers, the same way NewKratosClient's admin/public URLs do.
+var ProviderSet = wire.NewSet(NewKratosClient, NewClerkClient, NewConfig, NewProvider)